@@ -0,0 +1,18 @@
+package scene
+
+import "github.com/achilleasa/go-pathtrace/types"
+
+// Camera describes the viewpoint that a scene is rendered from.
+type Camera struct {
+	// The camera position in world space.
+	Eye types.Vec4
+
+	// The world space corners of the camera frustrum, used by the tracer
+	// to reconstruct primary ray directions for each pixel.
+	Frustrum [4]types.Vec4
+}
+
+// Position returns the camera's position in world space.
+func (c *Camera) Position() types.Vec4 {
+	return c.Eye
+}
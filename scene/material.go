@@ -0,0 +1,47 @@
+package scene
+
+import "image"
+
+// TextureKind identifies the role a texture plays on a material.
+type TextureKind uint8
+
+const (
+	TextureAlbedo TextureKind = iota
+	TextureNormal
+	TextureRoughness
+)
+
+// Material describes the surface properties of a primitive.
+type Material struct {
+	// Diffuse, emissive and other scalar/vector material properties live
+	// here; they are packed into a flat buffer by the tracer backend.
+	Diffuse   [3]float32
+	Emissive  [3]float32
+	Roughness float32
+
+	// Dielectric marks this material as a refractive surface (glass,
+	// water, ...) rather than an opaque one; IOR is its index of
+	// refraction and is only meaningful when Dielectric is set.
+	Dielectric bool
+	IOR        float32
+
+	// textures holds the optional bitmaps attached to this material,
+	// keyed by kind. Populated via SetTexture; looked up via Texture so
+	// the opencl packer can discover them without new Material fields
+	// every time a texture kind is added.
+	textures map[TextureKind]*image.RGBA
+}
+
+// Texture returns the bitmap attached to this material for the given kind,
+// or nil if the material doesn't carry one.
+func (m *Material) Texture(kind TextureKind) *image.RGBA {
+	return m.textures[kind]
+}
+
+// SetTexture attaches a bitmap of the given kind to this material.
+func (m *Material) SetTexture(kind TextureKind, img *image.RGBA) {
+	if m.textures == nil {
+		m.textures = make(map[TextureKind]*image.RGBA)
+	}
+	m.textures[kind] = img
+}
@@ -0,0 +1,7 @@
+package scene
+
+// Primitive is a single renderable shape together with the index of the
+// material it is shaded with.
+type Primitive struct {
+	MaterialIndex uint32
+}
@@ -0,0 +1,11 @@
+// Package scene contains the in-memory representation of a scene that can
+// be rendered by a tracer backend.
+package scene
+
+// Scene holds the primitives, materials and camera that make up a renderable
+// scene.
+type Scene struct {
+	Camera     *Camera
+	Primitives []Primitive
+	Materials  []Material
+}
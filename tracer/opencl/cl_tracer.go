@@ -15,8 +15,46 @@ import (
 
 const (
 	tracerSourceFile = "tracer/opencl/cl_tracer.cl"
+
+	// Number of blocks that may be in flight (uploaded, traced or read
+	// back) at the same time. Each in-flight block gets its own kernel
+	// and output buffer so that the three pipeline stages can overlap
+	// across consecutive BlockRequests instead of serializing on a
+	// single blocking enqueue/finish/enqueue round trip.
+	pipelineDepth = 3
 )
 
+// pipelineSlot tracks the opencl resources and events used to render a
+// single in-flight block. Slots are reused in round-robin order; the wait
+// list chaining below ensures a slot's write enqueue never clobbers a
+// buffer that is still being read back from a previous use.
+type pipelineSlot struct {
+	kernel      cl.Kernel
+	output      cl.Mem
+	kernelEvent cl.Event
+	readEvent   cl.Event
+
+	// accumKernel runs after kernel on every block, blending this
+	// block's raw radiance (output) into the tracer's persistent
+	// accumBuffer and writing a tonemapped LDR block into ldrOutput,
+	// which is what actually gets read back to the host below.
+	accumKernel cl.Kernel
+	ldrOutput   cl.Mem
+	accumEvent  cl.Event
+
+	// activePixels is a single-uint device buffer that accumKernel
+	// atomically increments for every pixel still above
+	// BlockRequest.TargetVariance; it's zeroed before each block and
+	// read back alongside ldrOutput to populate BlockRequest.ActiveChan.
+	activePixels cl.Mem
+
+	// mapped is set once this slot's ldrOutput buffer has been mapped via
+	// clEnqueueMapBuffer so that the next reuse of the slot knows to
+	// unmap it before writing into it again.
+	mapped    bool
+	mappedPtr unsafe.Pointer
+}
+
 type clTracer struct {
 	sync.Mutex
 	wg sync.WaitGroup
@@ -29,25 +67,52 @@ type clTracer struct {
 	// Opencl device used by this tracer.
 	device Device
 
-	// Opencl context.
-	ctx *cl.Context
+	// The device group this tracer was created against. Its context and
+	// scene buffers (packedMaterials, packedPrimitives, packedTextures,
+	// textureAtlasDesc, frustrumCorners) are shared with every other
+	// tracer in the group instead of being duplicated per device.
+	group *DeviceGroup
 
-	// Opencl command queue
+	// Opencl command queue, owned by this tracer against the group's
+	// shared context.
 	cmdQueue cl.CommandQueue
 
 	// The tracer opencl program.
 	traceProgram cl.Program
 
-	// A kernel that is run for each screen pixel.
+	// Reference kernel object; only used to tell whether Setup has already
+	// run. Each pipeline slot below holds its own cloned kernel so that
+	// concurrently in-flight blocks don't share bound arguments.
 	traceKernel cl.Kernel
 
-	// Device buffers where the kernel writes its output and frustrum corners.
-	traceOutput     cl.Mem
-	frustrumCorners cl.Mem
+	// Pool of in-flight pipeline slots, indexed round-robin by nextSlot.
+	pipeline [pipelineDepth]pipelineSlot
+	nextSlot int
+
+	// accumBuffer holds the running per-pixel mean (rgb) and variance (a)
+	// for this tracer's frame, surviving across BlockRequests so samples
+	// accumulate into a progressively converging image instead of each
+	// block being independently noisy. It is frame-sized (not per pipeline
+	// slot) and reset to zero whenever the camera moves; see syncScene.
+	accumBuffer cl.Mem
+
+	// Whether this tracer reads blocks back via clEnqueueMapBuffer
+	// instead of EnqueueReadBuffer. Decided once in setupKernel from
+	// device.PreferMappedIO and the device's reported unified memory
+	// support.
+	useMappedIO bool
+
+	// Whether this tracer's scene has textured materials; decided once in
+	// setupKernel and used to size the kernel template and to tell the
+	// group whether to upload a texture atlas.
+	hasTextures bool
 
-	// Device 1D images where the packed scene materials and primitives are stored.
-	packedMaterials  cl.Mem
-	packedPrimitives cl.Mem
+	// Whether this tracer has registered itself with tr.group via
+	// attachScene, and so must detach on cleanup.
+	attachedToGroup bool
+
+	// Options this tracer was created with; see TracerOptions.
+	opts TracerOptions
 
 	// The scene to be rendered.
 	scene *scene.Scene
@@ -63,20 +128,28 @@ type clTracer struct {
 	closeChan chan struct{}
 }
 
-// Create a new opencl tracer.
-func newTracer(id string, device Device) (*clTracer, error) {
-	var errptr *int32
+// TracerOptions configures optional behavior of a clTracer.
+type TracerOptions struct {
+	// ForceRebuild skips the on-disk program binary cache and always
+	// recompiles the specialized kernel from source, even if a cached
+	// binary for the same source and device is available.
+	ForceRebuild bool
+
+	// BinaryCacheDir is the directory used to cache compiled program
+	// binaries, keyed by the SHA-256 of the specialized kernel source
+	// plus device id. Left empty, caching is disabled and the kernel is
+	// compiled from source on every Setup.
+	BinaryCacheDir string
+}
 
-	// Create context
-	ctx := cl.CreateContext(nil, 1, &device.Id, nil, nil, errptr)
-	if errptr != nil && cl.ErrorCode(*errptr) != cl.SUCCESS {
-		return nil, ErrContextCreationFailed
-	}
+// Create a new opencl tracer against the given device group. The group's
+// context must already include device.
+func newTracer(id string, device Device, group *DeviceGroup, opts TracerOptions) (*clTracer, error) {
+	var errptr *int32
 
-	// Create command queue
-	cq := cl.CreateCommandQueue(*ctx, device.Id, 0, errptr)
+	// Create command queue against the group's shared context.
+	cq := cl.CreateCommandQueue(*group.ctx, device.Id, 0, errptr)
 	if errptr != nil && cl.ErrorCode(*errptr) != cl.SUCCESS {
-		cl.ReleaseContext(ctx)
 		return nil, ErrCmdQueueCreationFailed
 	}
 
@@ -85,8 +158,9 @@ func newTracer(id string, device Device) (*clTracer, error) {
 		logger:       log.New(os.Stderr, loggerPrefix, log.LstdFlags),
 		id:           id,
 		device:       device,
-		ctx:          ctx,
+		group:        group,
 		cmdQueue:     cq,
+		opts:         opts,
 		blockReqChan: make(chan tracer.BlockRequest, 0),
 		closeChan:    make(chan struct{}, 0),
 	}, nil
@@ -138,13 +212,15 @@ func (tr *clTracer) Setup(sc *scene.Scene, frameW, frameH uint32) error {
 		for {
 			select {
 			case blockReq = <-tr.blockReqChan:
-				// Render block and reply with our completion status
+				// Submit the block for pipelined processing. process
+				// only blocks long enough to enqueue the write, kernel
+				// and read stages; completion is reported asynchronously
+				// by the read event's callback so the submitter can move
+				// straight on to the next block.
 				err = tr.process(blockReq)
 				if err != nil {
 					blockReq.ErrChan <- err
-					continue
 				}
-				blockReq.DoneChan <- blockReq.BlockH
 			case <-tr.closeChan:
 				return
 			}
@@ -177,30 +253,52 @@ func (tr *clTracer) cleanup(useLock bool) {
 		defer tr.Unlock()
 	}
 
-	if tr.ctx == nil {
+	if tr.cmdQueue == nil {
 		return
 	}
 
-	// Signal worker to exit and wait till it exits
+	// Signal worker to exit and wait till it exits. This only waits for
+	// the submitter goroutine itself to return; process() returns as soon
+	// as a block's stages are enqueued, so without the Finish below the
+	// device could still be executing/reading a pipeline slot's buffers
+	// when they're released just below.
 	close(tr.closeChan)
 	tr.wg.Wait()
+	cl.Finish(tr.cmdQueue)
 
-	if tr.packedPrimitives != nil {
-		cl.ReleaseMemObject(tr.packedPrimitives)
-		tr.packedPrimitives = nil
-	}
-	if tr.packedMaterials != nil {
-		cl.ReleaseMemObject(tr.packedMaterials)
-		tr.packedMaterials = nil
-	}
-	if tr.traceOutput != nil {
-		cl.ReleaseMemObject(tr.traceOutput)
-		tr.traceOutput = nil
+	for i := range tr.pipeline {
+		slot := &tr.pipeline[i]
+		if slot.mapped {
+			cl.EnqueueUnmapMemObject(tr.cmdQueue, slot.ldrOutput, slot.mappedPtr, 0, nil, nil)
+			slot.mapped = false
+		}
+		if slot.activePixels != nil {
+			cl.ReleaseMemObject(slot.activePixels)
+			slot.activePixels = nil
+		}
+		if slot.ldrOutput != nil {
+			cl.ReleaseMemObject(slot.ldrOutput)
+			slot.ldrOutput = nil
+		}
+		if slot.output != nil {
+			cl.ReleaseMemObject(slot.output)
+			slot.output = nil
+		}
+		if slot.accumKernel != nil {
+			cl.ReleaseKernel(slot.accumKernel)
+			slot.accumKernel = nil
+		}
+		if slot.kernel != nil {
+			cl.ReleaseKernel(slot.kernel)
+			slot.kernel = nil
+		}
 	}
-	if tr.frustrumCorners != nil {
-		cl.ReleaseMemObject(tr.frustrumCorners)
-		tr.frustrumCorners = nil
+
+	if tr.accumBuffer != nil {
+		cl.ReleaseMemObject(tr.accumBuffer)
+		tr.accumBuffer = nil
 	}
+
 	if tr.traceKernel != nil {
 		cl.ReleaseKernel(tr.traceKernel)
 		tr.traceKernel = nil
@@ -213,133 +311,347 @@ func (tr *clTracer) cleanup(useLock bool) {
 		cl.ReleaseCommandQueue(tr.cmdQueue)
 		tr.cmdQueue = nil
 	}
-	if tr.ctx != nil {
-		cl.ReleaseContext(tr.ctx)
-		tr.ctx = nil
+
+	// Drop this tracer's reference to the group's shared context and
+	// scene buffers; they're only actually freed once every tracer in
+	// the group has detached.
+	if tr.attachedToGroup {
+		tr.group.detach(tr.id)
+		tr.attachedToGroup = false
 	}
 }
 
-// Process block request.
+// Process block request. Rather than blocking on each opencl stage, this
+// claims the next pool slot, chains trace kernel -> accumulate kernel ->
+// readback through event wait lists and returns as soon as the readback is
+// enqueued. The block is only reported as done once the readback's
+// completion callback fires (EnqueueReadBuffer's, or EnqueueMapBuffer's on
+// the mapped path), which lets the
+// submitter move straight on to the next block and keep several blocks in
+// flight on the device at once.
 func (tr *clTracer) process(blockReq tracer.BlockRequest) error {
-	eyePos := tr.scene.Camera.Position()
-
-	// Copy camera frustrum corners to allocated buffer.
-	errCode := cl.EnqueueWriteBuffer(
-		tr.cmdQueue,
-		tr.frustrumCorners,
-		cl.TRUE,
-		0,
-		4*16,
-		unsafe.Pointer(&tr.scene.Camera.Frustrum[0]),
-		0,
-		nil,
-		nil,
-	)
-	if errCode != cl.SUCCESS {
-		tr.logger.Printf("Failed to write frustrum corner data")
-		return ErrCopyingDataToDevice
+	tr.Lock()
+	slot := &tr.pipeline[tr.nextSlot]
+	tr.nextSlot = (tr.nextSlot + 1) % pipelineDepth
+	tr.Unlock()
+
+	// Reusing this slot's buffers would race with a still-pending read
+	// from its previous use, so make the next enqueue wait on that event.
+	// prevReadEvent is this slot's event from its previous use; once it's
+	// been consumed as a wait-list dependency below it is released, since
+	// nothing else in the tracer still needs it.
+	prevReadEvent := slot.readEvent
+	var reuseWaitList []cl.Event
+	if prevReadEvent != nil {
+		reuseWaitList = []cl.Event{prevReadEvent}
+	}
+
+	// A slot previously read back via clEnqueueMapBuffer must be unmapped
+	// before its ldrOutput buffer can be written into again; the mapped
+	// pointer handed to the renderer for that earlier block is no longer
+	// valid once this happens.
+	if slot.mapped {
+		errCode := cl.EnqueueUnmapMemObject(tr.cmdQueue, slot.ldrOutput, slot.mappedPtr, uint32(len(reuseWaitList)), eventListPtr(reuseWaitList), nil)
+		if errCode != cl.SUCCESS {
+			tr.logger.Printf("Failed to unmap previous block buffer")
+			return ErrCopyingDataToHost
+		}
+		slot.mapped = false
+		slot.mappedPtr = nil
 	}
 
-	// Set kernel params
-	errCode = cl.SetKernelArg(tr.traceKernel, 0, 8, unsafe.Pointer(&tr.traceOutput))
+	eyePos := tr.scene.Camera.Position()
+
+	// tr.group.frustrumCorners is shared by every tracer in the group, so
+	// unlike this slot's own buffers it is never written here: the group
+	// writes it once and fences every attached queue on that write via
+	// DeviceGroup.SyncScene, which is the only thing allowed to touch it.
+	// A per-block write from this queue would race with a sibling
+	// tracer's queue reading or writing the same cl_mem with no ordering
+	// between them.
+
+	// Set kernel params on this slot's own kernel object so that
+	// concurrently in-flight blocks don't clobber each other's bound args.
+	kernel := slot.kernel
+	errCode := cl.SetKernelArg(kernel, 0, 8, unsafe.Pointer(&slot.output))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 0")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 1, 8, unsafe.Pointer(&tr.frustrumCorners))
+	errCode = cl.SetKernelArg(kernel, 1, 8, unsafe.Pointer(&tr.group.frustrumCorners))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 1")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 2, 8, unsafe.Pointer(&tr.packedPrimitives))
+	errCode = cl.SetKernelArg(kernel, 2, 8, unsafe.Pointer(&tr.group.packedPrimitives))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 2")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 3, 8, unsafe.Pointer(&tr.packedMaterials))
+	errCode = cl.SetKernelArg(kernel, 3, 8, unsafe.Pointer(&tr.group.packedMaterials))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 3")
 		return ErrSettingKernelArguments
 	}
-	numPrimitives := len(tr.scene.Primitives)
-	errCode = cl.SetKernelArg(tr.traceKernel, 4, 4, unsafe.Pointer(&numPrimitives))
+	// numPrimitives is no longer a kernel arg: setupKernel bakes it into
+	// the specialized source as NUM_PRIMITIVES instead; see
+	// specializeKernelSource in kernel_spec.go for why.
+	errCode = cl.SetKernelArg(kernel, 4, 16, unsafe.Pointer(&eyePos[0]))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 4")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 5, 16, unsafe.Pointer(&eyePos[0]))
+	errCode = cl.SetKernelArg(kernel, 5, 4, unsafe.Pointer(&blockReq.BlockY))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 5")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 6, 4, unsafe.Pointer(&blockReq.BlockY))
+	errCode = cl.SetKernelArg(kernel, 6, 4, unsafe.Pointer(&blockReq.SamplesPerPixel))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 6")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 7, 4, unsafe.Pointer(&blockReq.SamplesPerPixel))
+	errCode = cl.SetKernelArg(kernel, 7, 4, unsafe.Pointer(&blockReq.Exposure))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 7")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 8, 4, unsafe.Pointer(&blockReq.Exposure))
+	errCode = cl.SetKernelArg(kernel, 8, 4, unsafe.Pointer(&blockReq.Seed))
 	if errCode != cl.SUCCESS {
 		tr.logger.Printf("Failed to write kernel arg 8")
 		return ErrSettingKernelArguments
 	}
-	errCode = cl.SetKernelArg(tr.traceKernel, 9, 4, unsafe.Pointer(&blockReq.Seed))
-	if errCode != cl.SUCCESS {
-		tr.logger.Printf("Failed to write kernel arg 9")
-		return ErrSettingKernelArguments
+	if tr.group.packedTextures != nil {
+		errCode = cl.SetKernelArg(kernel, 9, 8, unsafe.Pointer(&tr.group.packedTextures))
+		if errCode != cl.SUCCESS {
+			tr.logger.Printf("Failed to write kernel arg 9")
+			return ErrSettingKernelArguments
+		}
+		errCode = cl.SetKernelArg(kernel, 10, 8, unsafe.Pointer(&tr.group.textureAtlasDesc))
+		if errCode != cl.SUCCESS {
+			tr.logger.Printf("Failed to write kernel arg 10")
+			return ErrSettingKernelArguments
+		}
 	}
 
-	// Execute kernel
+	// Execute kernel once this slot's buffers are safe to reuse. The
+	// group-shared frustrum buffer needs no wait here: SyncScene already
+	// fenced this queue on its write before this block was ever enqueued.
 	workOffset := []uint64{0, uint64(blockReq.BlockY)}
 	workSize := []uint64{uint64(tr.frameW), uint64(blockReq.BlockH)}
+	kernelWaitList := reuseWaitList
 	errCode = cl.EnqueueNDRangeKernel(
 		tr.cmdQueue,
-		tr.traceKernel,
+		kernel,
 		2,
 		(*uint64)(unsafe.Pointer(&workOffset[0])),
 		(*uint64)(unsafe.Pointer(&workSize[0])),
 		nil,
-		0,
-		nil,
-		nil,
+		uint32(len(kernelWaitList)),
+		eventListPtr(kernelWaitList),
+		&slot.kernelEvent,
 	)
 	if errCode != cl.SUCCESS {
 		return ErrKernelExecutionFailed
 	}
+	if prevReadEvent != nil {
+		cl.ReleaseEvent(prevReadEvent)
+	}
+
+	// This kernel launch reads tr.group.frustrumCorners, so the group
+	// needs to know about it to fence a future SyncScene write against it;
+	// see DeviceGroup.noteKernelLaunch.
+	tr.group.noteKernelLaunch(tr.id, slot.kernelEvent)
+
+	// Zero this slot's active-pixel counter before accumKernel runs; it
+	// atomically counts pixels still above blockReq.TargetVariance.
+	var zeroActive uint32
+	var zeroEvent cl.Event
+	errCode = cl.EnqueueWriteBuffer(tr.cmdQueue, slot.activePixels, cl.FALSE, 0, 4, unsafe.Pointer(&zeroActive), 0, nil, &zeroEvent)
+	if errCode != cl.SUCCESS {
+		tr.logger.Printf("Failed to zero active pixel counter")
+		return ErrCopyingDataToDevice
+	}
 
-	// Wait for the kernel to finish executing
-	errCode = cl.Finish(tr.cmdQueue)
+	// Blend this block's raw radiance into the tracer's persistent
+	// accumBuffer and tonemap the running mean into slot.ldrOutput, which
+	// is what actually gets read back below.
+	accumKernel := slot.accumKernel
+	errCode = cl.SetKernelArg(accumKernel, 0, 8, unsafe.Pointer(&tr.accumBuffer))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 1, 8, unsafe.Pointer(&slot.output))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 2, 8, unsafe.Pointer(&slot.ldrOutput))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 3, 4, unsafe.Pointer(&blockReq.BlockY))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 4, 4, unsafe.Pointer(&blockReq.AccumFrame))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 5, 4, unsafe.Pointer(&blockReq.TargetVariance))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 6, 4, unsafe.Pointer(&blockReq.Exposure))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+	errCode = cl.SetKernelArg(accumKernel, 7, 8, unsafe.Pointer(&slot.activePixels))
+	if errCode != cl.SUCCESS {
+		return ErrSettingKernelArguments
+	}
+
+	accumWaitList := []cl.Event{slot.kernelEvent, zeroEvent}
+	errCode = cl.EnqueueNDRangeKernel(
+		tr.cmdQueue,
+		accumKernel,
+		2,
+		(*uint64)(unsafe.Pointer(&workOffset[0])),
+		(*uint64)(unsafe.Pointer(&workSize[0])),
+		nil,
+		uint32(len(accumWaitList)),
+		eventListPtr(accumWaitList),
+		&slot.accumEvent,
+	)
 	if errCode != cl.SUCCESS {
 		return ErrKernelExecutionFailed
 	}
+	// slot.kernelEvent and zeroEvent are only needed as accumKernel's wait
+	// list above; nothing downstream waits on them.
+	cl.ReleaseEvent(slot.kernelEvent)
+	cl.ReleaseEvent(zeroEvent)
 
-	// Copy the rendered block from device buffer to the render target
+	// Read the accumulated, tonemapped block back once accumKernel has
+	// finished. The callback registered on the resulting event is what
+	// actually signals completion to the renderer, so the submitter never
+	// blocks here.
 	readOffset := uint64(tr.frameW * 4 * 4 * blockReq.BlockY)
 	blockSizeBytes := uint64(tr.frameW * 4 * 4 * blockReq.BlockH)
+	accumEvent := slot.accumEvent
+
+	tr.reportActivePixels(blockReq, slot, accumEvent)
+
+	if tr.useMappedIO {
+		var mapErr int32
+		ptr := cl.EnqueueMapBuffer(tr.cmdQueue, slot.ldrOutput, cl.FALSE, cl.MAP_READ, readOffset, blockSizeBytes, 1, &accumEvent, &slot.readEvent, &mapErr)
+		if cl.ErrorCode(mapErr) == cl.SUCCESS && ptr != nil {
+			slot.mapped = true
+			slot.mappedPtr = ptr
+
+			readEvent := slot.readEvent
+			errCode = cl.SetEventCallback(readEvent, cl.COMPLETE, func(event cl.Event, status int32, userData unsafe.Pointer) {
+				if cl.ErrorCode(status) != cl.SUCCESS {
+					blockReq.ErrChan <- ErrCopyingDataToHost
+					return
+				}
+				// Alias the mapped host pointer as a []float32 so the
+				// renderer can read this block's pixels with no copy.
+				blockReq.MappedData = unsafe.Slice((*float32)(ptr), blockSizeBytes>>2)
+				blockReq.DoneChan <- blockReq.BlockH
+			}, nil)
+			if errCode != cl.SUCCESS {
+				tr.logger.Printf("Failed to register map completion callback")
+				return ErrCopyingDataToHost
+			}
+			// accumEvent's last dependent enqueue is the map above;
+			// slot.readEvent (this block's own completion event) stays
+			// alive for the next use of this slot to wait on.
+			cl.ReleaseEvent(accumEvent)
+			return nil
+		}
+
+		// Mapping failed or returned a nil pointer; fall through to the
+		// regular copy-based readback for this block instead of failing
+		// it. Whether a mapped pointer stays the same across enqueues is
+		// not checked.
+		tr.logger.Printf("clEnqueueMapBuffer failed (code %d), falling back to EnqueueReadBuffer", mapErr)
+		slot.mapped = false
+	}
+
 	errCode = cl.EnqueueReadBuffer(
 		tr.cmdQueue,
-		tr.traceOutput,
-		cl.TRUE,
+		slot.ldrOutput,
+		cl.FALSE,
 		readOffset,     // start at beginning of block
 		blockSizeBytes, // read just the block data
 		// target is []float32 so we need to divide offset by 4
 		unsafe.Pointer(&blockReq.RenderTarget[readOffset>>2]),
-		0,
-		nil,
-		nil,
+		1,
+		&accumEvent,
+		&slot.readEvent,
 	)
 	if errCode != cl.SUCCESS {
-		tr.logger.Printf("Error copying data to host: (blockY: %d, blockH: %d, readOffset: %d, bytes: %d, code %d)", blockReq.BlockY, blockReq.BlockH, readOffset, blockSizeBytes, errCode)
+		tr.logger.Printf("Error enqueuing readback: (blockY: %d, blockH: %d, readOffset: %d, bytes: %d, code %d)", blockReq.BlockY, blockReq.BlockH, readOffset, blockSizeBytes, errCode)
+		return ErrCopyingDataToHost
+	}
+	// accumEvent's last dependent enqueue is the read above; slot.readEvent
+	// (this block's own completion event) stays alive for the next use of
+	// this slot to wait on.
+	cl.ReleaseEvent(accumEvent)
+
+	readEvent := slot.readEvent
+	errCode = cl.SetEventCallback(readEvent, cl.COMPLETE, func(event cl.Event, status int32, userData unsafe.Pointer) {
+		if cl.ErrorCode(status) != cl.SUCCESS {
+			blockReq.ErrChan <- ErrCopyingDataToHost
+			return
+		}
+		blockReq.DoneChan <- blockReq.BlockH
+	}, nil)
+	if errCode != cl.SUCCESS {
+		tr.logger.Printf("Failed to register readback completion callback")
 		return ErrCopyingDataToHost
 	}
 
 	return nil
 }
 
+// reportActivePixels enqueues a readback of slot's active-pixel counter,
+// waiting on accumEvent, and forwards the result to blockReq.ActiveChan once
+// it lands. A nil ActiveChan means the renderer isn't tracking convergence
+// for this block, so the readback is skipped entirely.
+func (tr *clTracer) reportActivePixels(blockReq tracer.BlockRequest, slot *pipelineSlot, accumEvent cl.Event) {
+	if blockReq.ActiveChan == nil {
+		return
+	}
+
+	active := new(uint32)
+	var countEvent cl.Event
+	errCode := cl.EnqueueReadBuffer(tr.cmdQueue, slot.activePixels, cl.FALSE, 0, 4, unsafe.Pointer(active), 1, &accumEvent, &countEvent)
+	if errCode != cl.SUCCESS {
+		tr.logger.Printf("Failed to enqueue active pixel readback")
+		return
+	}
+
+	errCode = cl.SetEventCallback(countEvent, cl.COMPLETE, func(event cl.Event, status int32, userData unsafe.Pointer) {
+		defer cl.ReleaseEvent(event)
+		if cl.ErrorCode(status) != cl.SUCCESS {
+			return
+		}
+		blockReq.ActiveChan <- *active
+	}, nil)
+	if errCode != cl.SUCCESS {
+		tr.logger.Printf("Failed to register active pixel readback callback")
+	}
+}
+
+// eventListPtr returns a pointer to the first element of events, or nil for
+// an empty wait list, matching the *cl.Event parameter opencl calls expect.
+func eventListPtr(events []cl.Event) *cl.Event {
+	if len(events) == 0 {
+		return nil
+	}
+	return &events[0]
+}
+
 // Sync scene changes with the opencl device optionally using a lock.
 func (tr *clTracer) syncScene(useLock bool) error {
 	if useLock {
@@ -347,26 +659,29 @@ func (tr *clTracer) syncScene(useLock bool) error {
 		defer tr.Unlock()
 	}
 
-	if tr.ctx == nil {
+	if tr.group == nil {
 		return ErrPendingSetup
 	}
 
-	// Copy camera frustrum corners to allocated buffer.
-	errCode := cl.EnqueueWriteBuffer(
-		tr.cmdQueue,
-		tr.frustrumCorners,
-		cl.TRUE,
-		0,
-		4*16,
-		unsafe.Pointer(&tr.scene.Camera.Frustrum[0]),
-		0,
-		nil,
-		nil,
-	)
-	if errCode != cl.SUCCESS {
-		tr.logger.Printf("Failed to write frustrum corner data")
-		return ErrCopyingDataToDevice
+	// The frustrum buffer is shared by every tracer in the group, so the
+	// actual write (and fencing every other tracer's queue on it) is a
+	// group-wide operation.
+	if err := tr.group.SyncScene(tr.scene); err != nil {
+		return err
+	}
+
+	// A synced scene means the camera (or scene) just changed, so any
+	// progressive accumulation in accumBuffer is against a stale camera;
+	// zero it so the next block starts a fresh pass from AccumFrame 0
+	// instead of blending against pixels traced under the old one.
+	if tr.accumBuffer != nil {
+		var zero float32
+		errCode := cl.EnqueueFillBuffer(tr.cmdQueue, tr.accumBuffer, unsafe.Pointer(&zero), 4, 0, uint64(tr.frameW)*uint64(tr.frameH)*16, 0, nil, nil)
+		if errCode != cl.SUCCESS {
+			return ErrCopyingDataToDevice
+		}
 	}
+
 	return nil
 }
 
@@ -379,31 +694,53 @@ func (tr *clTracer) setupKernel(sc *scene.Scene, frameW, frameH uint32) error {
 	}
 	defer templateFile.Close()
 
-	template, err := ioutil.ReadAll(templateFile)
+	templateSrc, err := ioutil.ReadAll(templateFile)
 	if err != nil {
 		return err
 	}
 
-	// @todo: process the scene and embed object and material properties
-	// into the kernel using text/template
+	// Specialize the kernel source for this scene; see specializeKernelSource
+	// in kernel_spec.go for what gets baked in and why.
+	specializedSrc, spec, err := specializeKernelSource(string(templateSrc), sc)
+	if err != nil {
+		return err
+	}
+	hasTextures := spec.HasTextures
 
-	// Create and build program
-	var errPtr *int32
-	programSrc := cl.Str(string(template) + "\x00")
-	tr.traceProgram = cl.CreateProgramWithSource(*tr.ctx, 1, &programSrc, nil, errPtr)
-	if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
-		return ErrProgramCreationFailed
+	// A specialized kernel only ever needs recompiling when its source
+	// changes, so cache the built program on disk keyed by the source's
+	// hash plus device id and reload the binary on a hit instead of
+	// paying the multi-second compile every time a tracer is set up.
+	cacheKey := programCacheKey(specializedSrc, tr.device.Id)
+	if !tr.opts.ForceRebuild && tr.opts.BinaryCacheDir != "" {
+		if program, ok, err := loadCachedProgram(*tr.group.ctx, tr.device.Id, tr.opts.BinaryCacheDir, cacheKey); err == nil && ok {
+			tr.traceProgram = program
+		}
 	}
 
-	errCode := cl.BuildProgram(tr.traceProgram, 1, &tr.device.Id, nil, nil, nil)
-	if errCode != cl.SUCCESS {
-		var dataLen uint64
-		data := make([]byte, 120000)
+	var errPtr *int32
+	if tr.traceProgram == nil {
+		// Create and build program
+		programSrc := cl.Str(specializedSrc + "\x00")
+		tr.traceProgram = cl.CreateProgramWithSource(*tr.group.ctx, 1, &programSrc, nil, errPtr)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			return ErrProgramCreationFailed
+		}
 
-		cl.GetProgramBuildInfo(tr.traceProgram, tr.device.Id, cl.PROGRAM_BUILD_LOG, uint64(len(data)), unsafe.Pointer(&data[0]), &dataLen)
-		tr.logger.Printf("Error building kernel (log follows):\n%s\n", string(data[0:dataLen-1]))
-		tr.cleanup(false)
-		return ErrProgramBuildFailed
+		errCode := cl.BuildProgram(tr.traceProgram, 1, &tr.device.Id, nil, nil, nil)
+		if errCode != cl.SUCCESS {
+			var dataLen uint64
+			data := make([]byte, 120000)
+
+			cl.GetProgramBuildInfo(tr.traceProgram, tr.device.Id, cl.PROGRAM_BUILD_LOG, uint64(len(data)), unsafe.Pointer(&data[0]), &dataLen)
+			tr.logger.Printf("Error building kernel (log follows):\n%s\n", string(data[0:dataLen-1]))
+			tr.cleanup(false)
+			return ErrProgramBuildFailed
+		}
+
+		if tr.opts.BinaryCacheDir != "" {
+			saveCachedProgram(tr.traceProgram, tr.device.Id, tr.opts.BinaryCacheDir, cacheKey)
+		}
 	}
 
 	// Fetch kernel entrypoint and query global and local workgroup info
@@ -413,68 +750,87 @@ func (tr *clTracer) setupKernel(sc *scene.Scene, frameW, frameH uint32) error {
 		return ErrKernelCreationFailed
 	}
 
-	// Allocate an output buffer large enough to fit a full frame even
-	// though it will never be fully used if more than one tracers are used.
-	tr.traceOutput = cl.CreateBuffer(*tr.ctx, cl.MEM_WRITE_ONLY, cl.MemFlags(4*4*frameW*frameH), nil, errPtr)
-	if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
-		tr.cleanup(false)
-		return ErrAllocatingBuffers
+	// Decide whether to read blocks back via clEnqueueMapBuffer instead of
+	// EnqueueReadBuffer. Only worth it on devices that actually share
+	// host and device memory, in which case mapping avoids a redundant
+	// copy; otherwise fall back to the regular read path below.
+	var hostUnifiedMemory uint32
+	cl.GetDeviceInfo(tr.device.Id, cl.DEVICE_HOST_UNIFIED_MEMORY, 4, unsafe.Pointer(&hostUnifiedMemory), nil)
+	tr.useMappedIO = tr.device.PreferMappedIO && hostUnifiedMemory != 0
+
+	ldrOutputFlags := cl.MEM_WRITE_ONLY
+	if tr.useMappedIO {
+		ldrOutputFlags = cl.MEM_WRITE_ONLY | cl.MEM_ALLOC_HOST_PTR
 	}
 
-	// Allocate buffer for passing frustrum corners (4 x Vec4 = 64 bytes)
-	tr.frustrumCorners = cl.CreateBuffer(*tr.ctx, cl.MEM_READ_ONLY, 4*4*4, nil, errPtr)
+	// accumBuffer is frame-sized (not per pipeline slot) since it must
+	// survive across BlockRequests to accumulate samples; a scene/camera
+	// change resets it to zero via syncScene below instead of reallocating
+	// it.
+	tr.accumBuffer = cl.CreateBuffer(*tr.group.ctx, cl.MEM_READ_WRITE, cl.MemFlags(4*4*frameW*frameH), nil, errPtr)
 	if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
 		tr.cleanup(false)
 		return ErrAllocatingBuffers
 	}
 
-	// Pack scene data
-	packedMaterials, packedPrimitives, err := packScene(tr.scene)
-	if err != nil {
-		tr.cleanup(false)
-		return err
-	}
+	// Give every pipeline slot its own kernels (so concurrently in-flight
+	// blocks don't share bound arguments), its own frame-sized raw output
+	// buffer for tracePixel to write into, its own tonemapped ldrOutput
+	// buffer for accumulatePixel to write into (and what actually gets
+	// read back), and its own single-uint activePixels counter, so that
+	// pipeline stages for different blocks never contend on the same
+	// device memory.
+	for i := range tr.pipeline {
+		slot := &tr.pipeline[i]
 
-	// Allocate opencl images for packed data and upload it to device
-	if len(packedMaterials) > 0 {
-		sizeInBytes := uint64(uint64(len(packedMaterials)) * uint64(unsafe.Sizeof(packedMaterials[0])))
-		tr.packedMaterials = cl.CreateImage(
-			*tr.ctx,
-			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
-			cl.ImageFormat{cl.RGBA, cl.FLOAT}, // 16 bytes per pixel
-			cl.ImageDesc{
-				ImageType:     cl.MEM_OBJECT_IMAGE1D,
-				ImageWidth:    sizeInBytes >> 4,
-				ImageRowPitch: sizeInBytes,
-			},
-			unsafe.Pointer(&packedMaterials[0]),
-			errPtr,
-		)
+		slot.kernel = cl.CreateKernel(tr.traceProgram, cl.Str("tracePixel"+"\x00"), errPtr)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			tr.cleanup(false)
+			return ErrKernelCreationFailed
+		}
+
+		slot.accumKernel = cl.CreateKernel(tr.traceProgram, cl.Str("accumulatePixel"+"\x00"), errPtr)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			tr.cleanup(false)
+			return ErrKernelCreationFailed
+		}
+
+		slot.output = cl.CreateBuffer(*tr.group.ctx, cl.MEM_READ_WRITE, cl.MemFlags(4*4*frameW*frameH), nil, errPtr)
 		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
 			tr.cleanup(false)
 			return ErrAllocatingBuffers
 		}
-	}
-	if len(packedPrimitives) > 0 {
-		sizeInBytes := uint64(uint64(len(packedPrimitives)) * uint64(unsafe.Sizeof(packedPrimitives[0])))
-		tr.packedPrimitives = cl.CreateImage(
-			*tr.ctx,
-			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
-			cl.ImageFormat{cl.RGBA, cl.FLOAT}, // 16 bytes per pixel
-			cl.ImageDesc{
-				ImageType:     cl.MEM_OBJECT_IMAGE1D,
-				ImageWidth:    sizeInBytes >> 4,
-				ImageRowPitch: sizeInBytes,
-			},
-			unsafe.Pointer(&packedPrimitives[0]),
-			errPtr,
-		)
+
+		slot.ldrOutput = cl.CreateBuffer(*tr.group.ctx, ldrOutputFlags, cl.MemFlags(4*4*frameW*frameH), nil, errPtr)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			tr.cleanup(false)
+			return ErrAllocatingBuffers
+		}
+
+		slot.activePixels = cl.CreateBuffer(*tr.group.ctx, cl.MEM_READ_WRITE, cl.MemFlags(4), nil, errPtr)
 		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
 			tr.cleanup(false)
 			return ErrAllocatingBuffers
 		}
 	}
 
+	tr.hasTextures = hasTextures
+
+	// Register this tracer's queue with the group and, if it's the first
+	// tracer to attach, pack and upload the shared scene buffers
+	// (frustrumCorners, packedMaterials, packedPrimitives and, if the
+	// scene has textured materials, packedTextures/textureAtlasDesc).
+	// Every other tracer in the group reuses the same buffers instead of
+	// re-uploading the scene per device.
+	err = tr.group.attachScene(tr.id, tr.cmdQueue, tr.scene, hasTextures)
+	// attachScene registers the tracer before anything in it can fail, so
+	// cleanup owes the group a detach even when it returns an error.
+	tr.attachedToGroup = true
+	if err != nil {
+		tr.cleanup(false)
+		return err
+	}
+
 	// Sync scene
 	err = tr.syncScene(false)
 	if err != nil {
@@ -0,0 +1,112 @@
+package opencl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+	"github.com/achilleasa/go-pathtrace/tracer"
+)
+
+// firstDevice returns the first available opencl device, skipping the test
+// if none is present (e.g. in CI containers without a GPU/ICD installed).
+func firstDevice(t *testing.T) Device {
+	devices, err := EnumDevices()
+	if err != nil || len(devices) == 0 {
+		t.Skip("no opencl devices available")
+	}
+	return devices[0]
+}
+
+// TestPipelinedBlockProcessingOverlaps measures the wallclock cost of a
+// single blocking write/kernel/read round trip, then fires several more
+// blocks back to back without waiting on any of them until they have all
+// been enqueued. If process() actually overlaps the pipeline stages across
+// blocks instead of serializing on a full round trip each, total wallclock
+// for the batch should land well under numBlocks times the single-block
+// baseline.
+func TestPipelinedBlockProcessingOverlaps(t *testing.T) {
+	device := firstDevice(t)
+
+	group, err := NewDeviceGroup([]Device{device})
+	if err != nil {
+		t.Fatalf("NewDeviceGroup: %v", err)
+	}
+	defer group.Close()
+
+	tr, err := newTracer("test", device, group, TracerOptions{})
+	if err != nil {
+		t.Fatalf("newTracer: %v", err)
+	}
+	defer tr.Close()
+
+	const frameW, frameH = 64, 64
+	sc := &scene.Scene{Camera: &scene.Camera{}}
+	if err := tr.Setup(sc, frameW, frameH); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	renderTarget := make([]float32, frameW*frameH*4)
+
+	submitOne := func(blockY uint32) time.Duration {
+		done := make(chan uint32, 1)
+		errChan := make(chan error, 1)
+		start := time.Now()
+		tr.Enqueue(tracer.BlockRequest{
+			BlockY:          blockY,
+			BlockH:          1,
+			SamplesPerPixel: 1,
+			RenderTarget:    renderTarget,
+			DoneChan:        done,
+			ErrChan:         errChan,
+		})
+		select {
+		case <-done:
+		case err := <-errChan:
+			t.Fatalf("block %d failed: %v", blockY, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("block %d timed out", blockY)
+		}
+		return time.Since(start)
+	}
+
+	// Baseline: cost of a single block with nothing else in flight.
+	baseline := submitOne(0)
+
+	// Fire the rest of the batch without waiting between enqueues, so
+	// several blocks are in flight on the device at once, then collect
+	// them all.
+	const numBlocks = pipelineDepth * 4
+	dones := make([]chan uint32, numBlocks)
+	errChans := make([]chan error, numBlocks)
+	start := time.Now()
+	for i := 0; i < numBlocks; i++ {
+		dones[i] = make(chan uint32, 1)
+		errChans[i] = make(chan error, 1)
+		tr.Enqueue(tracer.BlockRequest{
+			BlockY:          uint32(i % frameH),
+			BlockH:          1,
+			SamplesPerPixel: 1,
+			RenderTarget:    renderTarget,
+			DoneChan:        dones[i],
+			ErrChan:         errChans[i],
+		})
+	}
+	for i := 0; i < numBlocks; i++ {
+		select {
+		case <-dones[i]:
+		case err := <-errChans[i]:
+			t.Fatalf("block %d failed: %v", i, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("block %d timed out", i)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// A strictly serial implementation pays a full round trip per block,
+	// so batch wallclock would land near numBlocks*baseline; pipelining
+	// should keep it well under that.
+	if budget := time.Duration(numBlocks) * baseline * 3 / 4; elapsed > budget {
+		t.Fatalf("pipelined submission did not overlap: %s for %d blocks (baseline %s, budget %s)", elapsed, numBlocks, baseline, budget)
+	}
+}
@@ -0,0 +1,51 @@
+package opencl
+
+import "github.com/achilleasa/gopencl/v1.2/cl"
+
+// Device describes an opencl-capable device that can be used to instantiate
+// a tracer.
+type Device struct {
+	// The opencl device id.
+	Id cl.DeviceId
+
+	// Human readable device name (e.g. as reported by cl.GetDeviceInfo).
+	Name string
+
+	// A relative throughput estimate (e.g. FLOPs) used to balance work
+	// across multiple tracers.
+	FlopsEstimate float32
+
+	// PreferMappedIO requests that the tracer, when the device reports
+	// CL_DEVICE_HOST_UNIFIED_MEMORY, read back blocks via
+	// clEnqueueMapBuffer/clEnqueueUnmapMemObject instead of
+	// EnqueueReadBuffer. This avoids an extra host copy per block on
+	// integrated GPUs where device memory already lives in host RAM.
+	// Ignored on devices that don't report unified memory.
+	PreferMappedIO bool
+}
+
+// SpeedEstimate returns a relative performance estimate for this device.
+func (d Device) SpeedEstimate() float32 {
+	return d.FlopsEstimate
+}
+
+// EnumDevices returns all opencl devices found across every available
+// platform.
+func EnumDevices() ([]Device, error) {
+	platforms, errCode := cl.GetPlatformIDs()
+	if errCode != cl.SUCCESS {
+		return nil, ErrPlatformEnumerationFailed
+	}
+
+	var devices []Device
+	for _, platform := range platforms {
+		deviceIds, errCode := cl.GetDeviceIDs(platform, cl.DEVICE_TYPE_ALL)
+		if errCode != cl.SUCCESS {
+			continue
+		}
+		for _, id := range deviceIds {
+			devices = append(devices, Device{Id: id, Name: cl.GetDeviceName(id)})
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,304 @@
+package opencl
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+	"github.com/achilleasa/gopencl/v1.2/cl"
+)
+
+// DeviceGroup owns a single opencl context shared by every tracer created
+// against it, plus the scene buffers that context makes visible to every
+// device: packedMaterials, packedPrimitives, packedTextures/
+// textureAtlasDesc and frustrumCorners are uploaded once by whichever
+// tracer attaches first instead of being duplicated per device, which cuts
+// scene-sync time and VRAM usage roughly linearly with device count.
+type DeviceGroup struct {
+	sync.Mutex
+
+	ctx     *cl.Context
+	devices []Device
+
+	// Command queues of tracers currently attached to this group, keyed
+	// by tracer id, so SyncScene can broadcast frustrum updates to all
+	// of them.
+	queues map[string]cl.CommandQueue
+
+	// Scene buffers shared across every tracer in the group. Populated
+	// once by the first call to attachScene.
+	frustrumCorners  cl.Mem
+	packedMaterials  cl.Mem
+	packedPrimitives cl.Mem
+	packedTextures   cl.Mem
+	textureAtlasDesc cl.Mem
+
+	// lastKernelEvent holds, per attached tracer id, the event of that
+	// tracer's most recently submitted tracePixel launch (the only kernel
+	// that reads frustrumCorners). SyncScene waits on all of them before
+	// overwriting frustrumCorners, since a queue's EnqueueBarrierWithWaitList
+	// only orders commands enqueued on it *after* the barrier and does
+	// nothing to protect the write itself from a still-running kernel on
+	// another device's queue.
+	lastKernelEvent map[string]cl.Event
+
+	// Number of tracers currently holding a reference to the buffers
+	// above; released once the last one detaches.
+	refCount int
+}
+
+// NewDeviceGroup creates a single opencl context spanning every given
+// device. Tracers created against the returned group each get their own
+// command queue, but share the group's context and scene buffers.
+func NewDeviceGroup(devices []Device) (*DeviceGroup, error) {
+	if len(devices) == 0 {
+		return nil, ErrNoDevices
+	}
+
+	ids := make([]cl.DeviceId, len(devices))
+	for i, d := range devices {
+		ids[i] = d.Id
+	}
+
+	var errptr *int32
+	ctx := cl.CreateContext(nil, uint32(len(ids)), &ids[0], nil, nil, errptr)
+	if errptr != nil && cl.ErrorCode(*errptr) != cl.SUCCESS {
+		return nil, ErrContextCreationFailed
+	}
+
+	return &DeviceGroup{
+		ctx:     ctx,
+		devices: devices,
+		queues:  make(map[string]cl.CommandQueue, len(devices)),
+	}, nil
+}
+
+// attachScene registers tracerId's command queue with the group and, on the
+// group's first call, uploads the shared scene buffers; later calls reuse
+// those buffers whatever scene they pass. Every
+// call must be matched with a detach once the tracer is closed.
+func (g *DeviceGroup) attachScene(tracerId string, cq cl.CommandQueue, sc *scene.Scene, hasTextures bool) error {
+	g.Lock()
+	defer g.Unlock()
+
+	g.queues[tracerId] = cq
+	g.refCount++
+
+	if g.frustrumCorners != nil {
+		// Another tracer in the group already uploaded the scene.
+		return nil
+	}
+
+	var errPtr *int32
+
+	g.frustrumCorners = cl.CreateBuffer(*g.ctx, cl.MEM_READ_ONLY, 4*4*4, nil, errPtr)
+	if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+		return ErrAllocatingBuffers
+	}
+
+	packedMaterials, packedPrimitives, err := packScene(sc)
+	if err != nil {
+		return err
+	}
+
+	if len(packedMaterials) > 0 {
+		sizeInBytes := uint64(len(packedMaterials)) * uint64(unsafe.Sizeof(packedMaterials[0]))
+		g.packedMaterials = cl.CreateImage(
+			*g.ctx,
+			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
+			cl.ImageFormat{cl.RGBA, cl.FLOAT},
+			cl.ImageDesc{
+				ImageType:     cl.MEM_OBJECT_IMAGE1D,
+				ImageWidth:    sizeInBytes >> 4,
+				ImageRowPitch: sizeInBytes,
+			},
+			unsafe.Pointer(&packedMaterials[0]),
+			errPtr,
+		)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			return ErrAllocatingBuffers
+		}
+	}
+
+	if len(packedPrimitives) > 0 {
+		sizeInBytes := uint64(len(packedPrimitives)) * uint64(unsafe.Sizeof(packedPrimitives[0]))
+		g.packedPrimitives = cl.CreateImage(
+			*g.ctx,
+			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
+			cl.ImageFormat{cl.RGBA, cl.FLOAT},
+			cl.ImageDesc{
+				ImageType:     cl.MEM_OBJECT_IMAGE1D,
+				ImageWidth:    sizeInBytes >> 4,
+				ImageRowPitch: sizeInBytes,
+			},
+			unsafe.Pointer(&packedPrimitives[0]),
+			errPtr,
+		)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			return ErrAllocatingBuffers
+		}
+	}
+
+	if hasTextures {
+		atlas, err := packTextures(sc)
+		if err != nil {
+			return err
+		}
+
+		g.packedTextures = cl.CreateImage(
+			*g.ctx,
+			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
+			cl.ImageFormat{cl.RGBA, cl.UNORM_INT8},
+			cl.ImageDesc{
+				ImageType:      cl.MEM_OBJECT_IMAGE2D_ARRAY,
+				ImageWidth:     uint64(atlas.width),
+				ImageHeight:    uint64(atlas.height),
+				ImageArraySize: uint64(atlas.layers),
+			},
+			unsafe.Pointer(&atlas.pixels[0]),
+			errPtr,
+		)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			return ErrAllocatingBuffers
+		}
+
+		g.textureAtlasDesc = cl.CreateBuffer(
+			*g.ctx,
+			cl.MEM_READ_ONLY|cl.MEM_COPY_HOST_PTR,
+			cl.MemFlags(4*len(atlas.desc)),
+			unsafe.Pointer(&atlas.desc[0]),
+			errPtr,
+		)
+		if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+			return ErrAllocatingBuffers
+		}
+	}
+
+	return nil
+}
+
+// noteKernelLaunch records event as tracerId's most recently submitted
+// tracePixel kernel launch, so a later SyncScene write knows to wait for it
+// before overwriting frustrumCorners. event is retained so it stays valid
+// after the caller releases its own reference to it.
+func (g *DeviceGroup) noteKernelLaunch(tracerId string, event cl.Event) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.lastKernelEvent == nil {
+		g.lastKernelEvent = make(map[string]cl.Event, len(g.queues))
+	}
+	cl.RetainEvent(event)
+	if prev, ok := g.lastKernelEvent[tracerId]; ok {
+		cl.ReleaseEvent(prev)
+	}
+	g.lastKernelEvent[tracerId] = event
+}
+
+// detach drops tracerId's reference to the group's shared buffers, freeing
+// them once the last attached tracer has gone away.
+func (g *DeviceGroup) detach(tracerId string) {
+	g.Lock()
+	defer g.Unlock()
+
+	delete(g.queues, tracerId)
+	if ev, ok := g.lastKernelEvent[tracerId]; ok {
+		cl.ReleaseEvent(ev)
+		delete(g.lastKernelEvent, tracerId)
+	}
+	g.refCount--
+	if g.refCount > 0 {
+		return
+	}
+
+	if g.packedPrimitives != nil {
+		cl.ReleaseMemObject(g.packedPrimitives)
+		g.packedPrimitives = nil
+	}
+	if g.packedMaterials != nil {
+		cl.ReleaseMemObject(g.packedMaterials)
+		g.packedMaterials = nil
+	}
+	if g.packedTextures != nil {
+		cl.ReleaseMemObject(g.packedTextures)
+		g.packedTextures = nil
+	}
+	if g.textureAtlasDesc != nil {
+		cl.ReleaseMemObject(g.textureAtlasDesc)
+		g.textureAtlasDesc = nil
+	}
+	if g.frustrumCorners != nil {
+		cl.ReleaseMemObject(g.frustrumCorners)
+		g.frustrumCorners = nil
+	}
+}
+
+// SyncScene writes the scene's current camera frustrum to the shared buffer
+// once, waiting on every attached tracer's last submitted kernel first (it
+// may still be reading the buffer's old contents), then fences every other
+// attached tracer's queue on the write so their next kernel launch is
+// guaranteed to observe it, without paying for a per-device copy of the
+// frustrum data.
+func (g *DeviceGroup) SyncScene(sc *scene.Scene) error {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.frustrumCorners == nil {
+		return ErrPendingSetup
+	}
+	if len(g.queues) == 0 {
+		return nil
+	}
+
+	var writeQueue cl.CommandQueue
+	for _, cq := range g.queues {
+		writeQueue = cq
+		break
+	}
+
+	writeWaitList := make([]cl.Event, 0, len(g.lastKernelEvent))
+	for _, ev := range g.lastKernelEvent {
+		writeWaitList = append(writeWaitList, ev)
+	}
+
+	var writeEvent cl.Event
+	errCode := cl.EnqueueWriteBuffer(
+		writeQueue,
+		g.frustrumCorners,
+		cl.FALSE,
+		0,
+		4*16,
+		unsafe.Pointer(&sc.Camera.Frustrum[0]),
+		uint32(len(writeWaitList)),
+		eventListPtr(writeWaitList),
+		&writeEvent,
+	)
+	if errCode != cl.SUCCESS {
+		return ErrCopyingDataToDevice
+	}
+
+	for _, cq := range g.queues {
+		if cq == writeQueue {
+			continue
+		}
+		errCode = cl.EnqueueBarrierWithWaitList(cq, 1, &writeEvent, nil)
+		if errCode != cl.SUCCESS {
+			return ErrCopyingDataToDevice
+		}
+	}
+
+	return nil
+}
+
+// Close releases the group's context. Callers must ensure every tracer
+// created against the group has already been closed.
+func (g *DeviceGroup) Close() {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.ctx == nil {
+		return
+	}
+	cl.ReleaseContext(g.ctx)
+	g.ctx = nil
+}
@@ -0,0 +1,76 @@
+package opencl
+
+import (
+	"testing"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+	"github.com/achilleasa/gopencl/v1.2/cl"
+)
+
+// cqForTest creates a command queue against group's shared context, mirroring
+// what newTracer does, so attachScene has something real to enqueue against.
+func cqForTest(t *testing.T, group *DeviceGroup, device Device) cl.CommandQueue {
+	t.Helper()
+	var errptr *int32
+	cq := cl.CreateCommandQueue(*group.ctx, device.Id, 0, errptr)
+	if errptr != nil && cl.ErrorCode(*errptr) != cl.SUCCESS {
+		t.Fatalf("CreateCommandQueue: %v", *errptr)
+	}
+	t.Cleanup(func() { cl.ReleaseCommandQueue(cq) })
+	return cq
+}
+
+// TestDeviceGroupAttachDetachRefcounting checks that the group's shared
+// scene buffers are uploaded once on the first attach, reused (not
+// re-uploaded) by later attaches, and only released once the last attached
+// tracer detaches.
+func TestDeviceGroupAttachDetachRefcounting(t *testing.T) {
+	device := firstDevice(t)
+
+	group, err := NewDeviceGroup([]Device{device})
+	if err != nil {
+		t.Fatalf("NewDeviceGroup: %v", err)
+	}
+	defer group.Close()
+
+	sc := &scene.Scene{Camera: &scene.Camera{}}
+
+	cqA := cqForTest(t, group, device)
+	if err := group.attachScene("a", cqA, sc, false); err != nil {
+		t.Fatalf("attachScene(a): %v", err)
+	}
+	sharedFrustrum := group.frustrumCorners
+	if sharedFrustrum == nil {
+		t.Fatalf("attachScene did not allocate frustrumCorners")
+	}
+	if group.refCount != 1 {
+		t.Fatalf("refCount = %d, want 1", group.refCount)
+	}
+
+	cqB := cqForTest(t, group, device)
+	if err := group.attachScene("b", cqB, sc, false); err != nil {
+		t.Fatalf("attachScene(b): %v", err)
+	}
+	if group.refCount != 2 {
+		t.Fatalf("refCount = %d, want 2", group.refCount)
+	}
+	if group.frustrumCorners != sharedFrustrum {
+		t.Fatalf("second attach re-allocated the shared frustrum buffer instead of reusing it")
+	}
+
+	group.detach("a")
+	if group.refCount != 1 {
+		t.Fatalf("refCount after first detach = %d, want 1", group.refCount)
+	}
+	if group.frustrumCorners == nil {
+		t.Fatalf("frustrumCorners released while a tracer is still attached")
+	}
+
+	group.detach("b")
+	if group.refCount != 0 {
+		t.Fatalf("refCount after last detach = %d, want 0", group.refCount)
+	}
+	if group.frustrumCorners != nil {
+		t.Fatalf("frustrumCorners not released once the last tracer detached")
+	}
+}
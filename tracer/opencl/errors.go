@@ -0,0 +1,22 @@
+package opencl
+
+import "errors"
+
+// Errors returned by the opencl tracer.
+var (
+	ErrContextCreationFailed     = errors.New("opencl: could not create context")
+	ErrCmdQueueCreationFailed    = errors.New("opencl: could not create command queue")
+	ErrAlreadyAttached           = errors.New("opencl: tracer is already attached to a scene")
+	ErrPendingSetup              = errors.New("opencl: tracer has not been setup yet")
+	ErrCopyingDataToDevice       = errors.New("opencl: could not copy data to device")
+	ErrCopyingDataToHost         = errors.New("opencl: could not copy data to host")
+	ErrSettingKernelArguments    = errors.New("opencl: could not set kernel arguments")
+	ErrKernelExecutionFailed     = errors.New("opencl: kernel execution failed")
+	ErrProgramCreationFailed     = errors.New("opencl: could not create program")
+	ErrProgramBuildFailed        = errors.New("opencl: could not build program")
+	ErrKernelCreationFailed      = errors.New("opencl: could not create kernel")
+	ErrAllocatingBuffers         = errors.New("opencl: could not allocate device buffers")
+	ErrPlatformEnumerationFailed = errors.New("opencl: could not enumerate platforms")
+	ErrMismatchedTextureSize     = errors.New("opencl: all material textures must share the same dimensions")
+	ErrNoDevices                 = errors.New("opencl: device group requires at least one device")
+)
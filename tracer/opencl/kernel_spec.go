@@ -0,0 +1,91 @@
+package opencl
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+)
+
+// tracerWorkgroupSize is the local work size the specialized kernel is built
+// for. It is baked into the source as a #define rather than passed via
+// clEnqueueNDRangeKernel's local work size so the kernel body can size local
+// memory off it without depending on the launch call getting it right.
+const tracerWorkgroupSize = 64
+
+// kernelMaterial is the per-material data inlined into the specialized
+// kernel's materialAt() switch, letting the kernel resolve a material's
+// properties without a packedMaterials buffer lookup.
+type kernelMaterial struct {
+	Index      int
+	Diffuse    [3]float32
+	Emissive   [3]float32
+	Roughness  float32
+	Dielectric bool
+	IOR        float32
+}
+
+// kernelTemplateData is the data made available to cl_tracer.cl when it is
+// run through text/template in specializeKernelSource.
+type kernelTemplateData struct {
+	HasTextures   bool
+	HasEmissive   bool
+	HasDielectric bool
+	NumPrimitives int
+	NumMaterials  int
+	WorkgroupSize int
+	Materials     []kernelMaterial
+}
+
+// specializeKernelSource runs the tracer kernel template against sc, baking
+// primitive/material counts, feature toggles and a per-material switch into
+// the source as compile-time constants/branches rather than plain kernel
+// arguments. setupKernel calls it once per Setup, so the baked-in values are
+// fixed for the lifetime of the built program: SyncScene only re-uploads the
+// camera frustrum, and material or primitive changes made after Setup are
+// not seen by the kernel.
+func specializeKernelSource(templateSrc string, sc *scene.Scene) (string, kernelTemplateData, error) {
+	data := kernelTemplateData{
+		NumPrimitives: len(sc.Primitives),
+		NumMaterials:  len(sc.Materials),
+		WorkgroupSize: tracerWorkgroupSize,
+		Materials:     make([]kernelMaterial, len(sc.Materials)),
+	}
+
+	for i := range sc.Materials {
+		mat := &sc.Materials[i]
+		for _, kind := range textureKinds {
+			if mat.Texture(kind) != nil {
+				data.HasTextures = true
+				break
+			}
+		}
+		if mat.Emissive != [3]float32{} {
+			data.HasEmissive = true
+		}
+		if mat.Dielectric {
+			data.HasDielectric = true
+		}
+
+		data.Materials[i] = kernelMaterial{
+			Index:      i,
+			Diffuse:    mat.Diffuse,
+			Emissive:   mat.Emissive,
+			Roughness:  mat.Roughness,
+			Dielectric: mat.Dielectric,
+			IOR:        mat.IOR,
+		}
+	}
+
+	kernelTmpl, err := template.New("cl_tracer").Parse(templateSrc)
+	if err != nil {
+		return "", kernelTemplateData{}, err
+	}
+
+	var specialized bytes.Buffer
+	if err := kernelTmpl.Execute(&specialized, data); err != nil {
+		return "", kernelTemplateData{}, err
+	}
+
+	return specialized.String(), data, nil
+}
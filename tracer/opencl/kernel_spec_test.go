@@ -0,0 +1,60 @@
+package opencl
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+)
+
+func TestSpecializeKernelSourceCounts(t *testing.T) {
+	sc := &scene.Scene{
+		Materials: []scene.Material{
+			{Diffuse: [3]float32{1, 0, 0}},
+			{Emissive: [3]float32{1, 1, 1}},
+		},
+		Primitives: []scene.Primitive{{}, {}, {}},
+	}
+
+	src, spec, err := specializeKernelSource("#define NUM_PRIMITIVES {{.NumPrimitives}}\n#define NUM_MATERIALS {{.NumMaterials}}\n", sc)
+	if err != nil {
+		t.Fatalf("specializeKernelSource: %v", err)
+	}
+
+	if spec.NumPrimitives != len(sc.Primitives) {
+		t.Errorf("NumPrimitives = %d, want %d", spec.NumPrimitives, len(sc.Primitives))
+	}
+	if spec.NumMaterials != len(sc.Materials) {
+		t.Errorf("NumMaterials = %d, want %d", spec.NumMaterials, len(sc.Materials))
+	}
+	if !spec.HasEmissive {
+		t.Errorf("HasEmissive = false, want true (second material is emissive)")
+	}
+	if spec.HasDielectric {
+		t.Errorf("HasDielectric = true, want false (no dielectric materials)")
+	}
+
+	if !strings.Contains(src, "#define NUM_PRIMITIVES 3") {
+		t.Errorf("specialized source missing NUM_PRIMITIVES: %s", src)
+	}
+	if !strings.Contains(src, "#define NUM_MATERIALS 2") {
+		t.Errorf("specialized source missing NUM_MATERIALS: %s", src)
+	}
+}
+
+func TestSpecializeKernelSourceHasTextures(t *testing.T) {
+	sc := &scene.Scene{
+		Materials: []scene.Material{{}},
+	}
+	sc.Materials[0].SetTexture(scene.TextureAlbedo, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	_, spec, err := specializeKernelSource("", sc)
+	if err != nil {
+		t.Fatalf("specializeKernelSource: %v", err)
+	}
+
+	if !spec.HasTextures {
+		t.Errorf("HasTextures = false, want true")
+	}
+}
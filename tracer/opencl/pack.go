@@ -0,0 +1,137 @@
+package opencl
+
+import "github.com/achilleasa/go-pathtrace/scene"
+
+// textureKinds lists the texture slots packed into the atlas, in the order
+// their layers appear. Keep this in sync with the layer indices baked into
+// textureAtlasDesc below and with the sampling helpers in cl_tracer.cl.
+var textureKinds = []scene.TextureKind{scene.TextureAlbedo, scene.TextureNormal, scene.TextureRoughness}
+
+// textureAtlas holds the packed RGBA pixels for every material texture,
+// laid out as consecutive CL_MEM_OBJECT_IMAGE2D_ARRAY slices (one per mip
+// level per texture), plus a descriptor mapping each (material, kind) pair
+// to its base layer and mip count.
+type textureAtlas struct {
+	width, height, layers int
+	pixels                []byte    // layers * width * height * 4 bytes, RGBA8
+	desc                  []float32 // len(sc.Materials) * len(textureKinds) * 2; (baseLayer, mipCount) pairs, baseLayer == -1 when absent
+}
+
+// packTextures packs every texture referenced by the scene's materials into
+// a single image array so they can be uploaded as one image object;
+// DeviceGroup.attachScene creates that image with the pixels copied in at
+// creation (MEM_COPY_HOST_PTR) and issues no separate clEnqueueWriteImage.
+// All textures must share the first texture's base (mip 0) dimensions;
+// mixed-size atlases aren't supported yet. Since scene.Material only carries
+// one bitmap per kind, each texture's mip chain is generated here (box-filter
+// downsampling down to 1x1) rather than supplied by the scene, with every
+// level packed as its own array slice; see buildMipChain.
+func packTextures(sc *scene.Scene) (*textureAtlas, error) {
+	atlas := &textureAtlas{
+		desc: make([]float32, len(sc.Materials)*len(textureKinds)*2),
+	}
+	for i := 0; i < len(atlas.desc); i += 2 {
+		atlas.desc[i] = -1
+	}
+
+	for matIdx := range sc.Materials {
+		mat := &sc.Materials[matIdx]
+		for kindIdx, kind := range textureKinds {
+			img := mat.Texture(kind)
+			if img == nil {
+				continue
+			}
+
+			w, h := img.Bounds().Dx(), img.Bounds().Dy()
+			if atlas.layers == 0 {
+				atlas.width, atlas.height = w, h
+			} else if w != atlas.width || h != atlas.height {
+				return nil, ErrMismatchedTextureSize
+			}
+
+			mips := buildMipChain(img.Pix, atlas.width, atlas.height)
+			descIdx := 2 * (matIdx*len(textureKinds) + kindIdx)
+			atlas.desc[descIdx] = float32(atlas.layers)
+			atlas.desc[descIdx+1] = float32(len(mips))
+			for _, mip := range mips {
+				atlas.pixels = append(atlas.pixels, mip...)
+				atlas.layers++
+			}
+		}
+	}
+
+	return atlas, nil
+}
+
+// buildMipChain box-filters a base RGBA8 image down to 1x1, one halving per
+// level. Every level is padded out to the full atlasW x atlasH slice size
+// (its actual content sits in that slice's top-left corner) since every
+// layer of an image2d_array must share the same declared dimensions;
+// sampleTexture in cl_tracer.cl rescales uv to compensate.
+func buildMipChain(base []byte, atlasW, atlasH int) [][]byte {
+	levels := [][]byte{base}
+	w, h := atlasW, atlasH
+	for w > 1 || h > 1 {
+		levels = append(levels, downsample2x(levels[len(levels)-1], atlasW, atlasH, w, h))
+		w, h = mip1(w/2), mip1(h/2)
+	}
+	return levels
+}
+
+// downsample2x box-filters the wxh content of an atlasW x atlasH RGBA8
+// slice into a new atlasW x atlasH slice holding the halved image in its
+// top-left corner.
+func downsample2x(src []byte, atlasW, atlasH, w, h int) []byte {
+	nw, nh := mip1(w/2), mip1(h/2)
+	dst := make([]byte, atlasW*atlasH*4)
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			var sum [4]int
+			samples := 0
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := x*2+dx, y*2+dy
+					if sx >= w || sy >= h {
+						continue
+					}
+					off := (sy*atlasW + sx) * 4
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src[off+c])
+					}
+					samples++
+				}
+			}
+			off := (y*atlasW + x) * 4
+			for c := 0; c < 4; c++ {
+				dst[off+c] = byte(sum[c] / samples)
+			}
+		}
+	}
+	return dst
+}
+
+// mip1 clamps a halved mip dimension to a minimum of 1 texel.
+func mip1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// packScene flattens the scene's materials and primitives into the 1D
+// buffers expected by the opencl kernel.
+func packScene(sc *scene.Scene) (packedMaterials []float32, packedPrimitives []float32, err error) {
+	packedMaterials = make([]float32, 0, len(sc.Materials)*4)
+	for _, mat := range sc.Materials {
+		packedMaterials = append(packedMaterials,
+			mat.Diffuse[0], mat.Diffuse[1], mat.Diffuse[2], mat.Roughness,
+		)
+	}
+
+	packedPrimitives = make([]float32, 0, len(sc.Primitives)*4)
+	for _, prim := range sc.Primitives {
+		packedPrimitives = append(packedPrimitives, float32(prim.MaterialIndex), 0, 0, 0)
+	}
+
+	return packedMaterials, packedPrimitives, nil
+}
@@ -0,0 +1,121 @@
+package opencl
+
+import (
+	"image"
+	"testing"
+
+	"github.com/achilleasa/go-pathtrace/scene"
+)
+
+// solidRGBA returns a w x h RGBA image filled with c.
+func solidRGBA(w, h int, c [4]byte) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:i+4], c[:])
+	}
+	return img
+}
+
+func TestPackScene(t *testing.T) {
+	sc := &scene.Scene{
+		Materials: []scene.Material{
+			{Diffuse: [3]float32{1, 0, 0}, Roughness: 0.5},
+			{Diffuse: [3]float32{0, 1, 0}, Roughness: 0.25},
+		},
+		Primitives: []scene.Primitive{
+			{MaterialIndex: 0},
+			{MaterialIndex: 1},
+		},
+	}
+
+	packedMaterials, packedPrimitives, err := packScene(sc)
+	if err != nil {
+		t.Fatalf("packScene: %v", err)
+	}
+
+	wantMaterials := []float32{1, 0, 0, 0.5, 0, 1, 0, 0.25}
+	if len(packedMaterials) != len(wantMaterials) {
+		t.Fatalf("packedMaterials = %v, want %v", packedMaterials, wantMaterials)
+	}
+	for i, v := range wantMaterials {
+		if packedMaterials[i] != v {
+			t.Errorf("packedMaterials[%d] = %v, want %v", i, packedMaterials[i], v)
+		}
+	}
+
+	wantPrimitives := []float32{0, 0, 0, 0, 1, 0, 0, 0}
+	if len(packedPrimitives) != len(wantPrimitives) {
+		t.Fatalf("packedPrimitives = %v, want %v", packedPrimitives, wantPrimitives)
+	}
+	for i, v := range wantPrimitives {
+		if packedPrimitives[i] != v {
+			t.Errorf("packedPrimitives[%d] = %v, want %v", i, packedPrimitives[i], v)
+		}
+	}
+}
+
+func TestPackTexturesDescAndMipCount(t *testing.T) {
+	sc := &scene.Scene{
+		Materials: []scene.Material{
+			{},
+		},
+	}
+	sc.Materials[0].SetTexture(scene.TextureAlbedo, solidRGBA(4, 4, [4]byte{255, 0, 0, 255}))
+
+	atlas, err := packTextures(sc)
+	if err != nil {
+		t.Fatalf("packTextures: %v", err)
+	}
+
+	// 4x4 halves to 2x2, 1x1: three mip levels.
+	const wantMips = 3
+	descIdx := 2 * (0*len(textureKinds) + 0)
+	if got := atlas.desc[descIdx]; got != 0 {
+		t.Errorf("baseLayer = %v, want 0", got)
+	}
+	if got := atlas.desc[descIdx+1]; got != wantMips {
+		t.Errorf("mipCount = %v, want %d", got, wantMips)
+	}
+	if atlas.layers != wantMips {
+		t.Errorf("atlas.layers = %d, want %d", atlas.layers, wantMips)
+	}
+
+	// Untextured kinds stay at baseLayer -1.
+	normalIdx := 2 * (0*len(textureKinds) + 1)
+	if got := atlas.desc[normalIdx]; got != -1 {
+		t.Errorf("baseLayer for absent texture = %v, want -1", got)
+	}
+}
+
+func TestPackTexturesMismatchedSize(t *testing.T) {
+	sc := &scene.Scene{
+		Materials: []scene.Material{
+			{}, {},
+		},
+	}
+	sc.Materials[0].SetTexture(scene.TextureAlbedo, solidRGBA(4, 4, [4]byte{}))
+	sc.Materials[1].SetTexture(scene.TextureAlbedo, solidRGBA(8, 8, [4]byte{}))
+
+	if _, err := packTextures(sc); err != ErrMismatchedTextureSize {
+		t.Fatalf("packTextures error = %v, want %v", err, ErrMismatchedTextureSize)
+	}
+}
+
+func TestBuildMipChainAverages(t *testing.T) {
+	// A 2x2 image with two distinct colors per row should average down to
+	// a single mid-tone pixel at the 1x1 level.
+	base := []byte{
+		10, 20, 30, 255, /**/ 30, 40, 50, 255,
+		10, 20, 30, 255, /**/ 30, 40, 50, 255,
+	}
+	mips := buildMipChain(base, 2, 2)
+	if len(mips) != 2 {
+		t.Fatalf("len(mips) = %d, want 2", len(mips))
+	}
+
+	want := [4]byte{20, 30, 40, 255}
+	got := [4]byte{mips[1][0], mips[1][1], mips[1][2], mips[1][3]}
+	if got != want {
+		t.Errorf("mip1 top-left texel = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package opencl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/achilleasa/gopencl/v1.2/cl"
+)
+
+// programCacheKey identifies a compiled program by the specialized source
+// that produced it and the device it was built for, so a scene change (which
+// alters the specialized source via specializeKernelSource) or a different
+// device always misses the cache instead of loading a stale binary.
+func programCacheKey(source string, deviceId cl.DeviceId) string {
+	h := sha256.New()
+	h.Write([]byte(source))
+	fmt.Fprintf(h, "%v", deviceId)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCachedProgram builds a program from a previously cached binary for
+// key, if one exists under cacheDir. A miss (including a cacheDir that
+// hasn't been created yet) is not an error; the caller falls back to
+// compiling from source.
+func loadCachedProgram(ctx cl.Context, deviceId cl.DeviceId, cacheDir, key string) (cl.Program, bool, error) {
+	binary, err := ioutil.ReadFile(filepath.Join(cacheDir, key+".bin"))
+	if err != nil || len(binary) == 0 {
+		return nil, false, nil
+	}
+
+	var errPtr *int32
+	var binaryStatus int32
+	binLen := uint64(len(binary))
+	binPtr := &binary[0]
+	program := cl.CreateProgramWithBinary(ctx, 1, &deviceId, &binLen, &binPtr, &binaryStatus, errPtr)
+	if errPtr != nil && cl.ErrorCode(*errPtr) != cl.SUCCESS {
+		return nil, false, nil
+	}
+	if cl.ErrorCode(binaryStatus) != cl.SUCCESS {
+		return nil, false, nil
+	}
+
+	errCode := cl.BuildProgram(program, 1, &deviceId, nil, nil, nil)
+	if errCode != cl.SUCCESS {
+		// The cached binary may target a driver/device revision that
+		// no longer accepts it; fall back to a source rebuild rather
+		// than failing setup outright.
+		cl.ReleaseProgram(program)
+		return nil, false, nil
+	}
+
+	return program, true, nil
+}
+
+// saveCachedProgram writes program's compiled binary for deviceId to
+// cacheDir under key, so the next tracer for the same specialized source and
+// device can skip straight to loadCachedProgram. Failures are non-fatal;
+// the program built fine, we just don't get to reuse it next time.
+func saveCachedProgram(program cl.Program, deviceId cl.DeviceId, cacheDir, key string) {
+	var binSize uint64
+	errCode := cl.GetProgramInfo(program, cl.PROGRAM_BINARY_SIZES, 8, unsafe.Pointer(&binSize), nil)
+	if errCode != cl.SUCCESS || binSize == 0 {
+		return
+	}
+
+	binary := make([]byte, binSize)
+	binPtr := &binary[0]
+	errCode = cl.GetProgramInfo(program, cl.PROGRAM_BINARIES, 8, unsafe.Pointer(&binPtr), nil)
+	if errCode != cl.SUCCESS {
+		return
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(filepath.Join(cacheDir, key+".bin"), binary, 0644)
+}
@@ -0,0 +1,34 @@
+package opencl
+
+import (
+	"testing"
+
+	"github.com/achilleasa/gopencl/v1.2/cl"
+)
+
+func TestProgramCacheKeyStability(t *testing.T) {
+	var device cl.DeviceId
+
+	k1 := programCacheKey("kernel source A", device)
+	k2 := programCacheKey("kernel source A", device)
+	if k1 != k2 {
+		t.Errorf("same source+device produced different keys: %q vs %q", k1, k2)
+	}
+
+	if k3 := programCacheKey("kernel source B", device); k3 == k1 {
+		t.Errorf("different source produced the same key as source A: %q", k3)
+	}
+}
+
+func TestProgramCacheKeyVariesByDevice(t *testing.T) {
+	devices, err := EnumDevices()
+	if err != nil || len(devices) < 2 {
+		t.Skip("need at least two opencl devices to exercise device-sensitivity")
+	}
+
+	k1 := programCacheKey("kernel source", devices[0].Id)
+	k2 := programCacheKey("kernel source", devices[1].Id)
+	if k1 == k2 {
+		t.Errorf("different devices produced the same cache key: %q", k1)
+	}
+}
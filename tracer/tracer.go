@@ -0,0 +1,75 @@
+// Package tracer defines the interface implemented by path tracer backends
+// and the block-oriented work unit they consume.
+package tracer
+
+// BlockRequest describes a horizontal strip of the frame that a tracer
+// implementation should render and the channels used to report the outcome.
+type BlockRequest struct {
+	// The y offset and height of the block inside the frame.
+	BlockY uint32
+	BlockH uint32
+
+	// The number of samples to trace for each pixel in the block.
+	SamplesPerPixel uint32
+
+	// Exposure applied to the traced radiance before tonemapping.
+	Exposure float32
+
+	// Seed for the tracer's random number generator.
+	Seed uint32
+
+	// AccumFrame is this block's index within the scene's current
+	// progressive accumulation; 0 on the first block after a camera move
+	// or scene change. Tracers that accumulate samples across frames use
+	// it to weight the running per-pixel mean, and reset their
+	// accumulation buffer back to frame 0 when the camera moves.
+	AccumFrame uint32
+
+	// TargetVariance is the per-pixel variance threshold below which a
+	// pixel is considered converged. Tracers that track per-pixel
+	// variance stop updating pixels below this threshold and report how
+	// many pixels in the block are still active via ActiveChan.
+	TargetVariance float32
+
+	// The frame buffer that the rendered block should be copied into.
+	RenderTarget []float32
+
+	// MappedData is set by tracers that support zero-copy readback
+	// (see Device.PreferMappedIO) instead of copying into RenderTarget.
+	// When non-nil once DoneChan fires, the renderer should read the
+	// block's pixels directly from this slice rather than from
+	// RenderTarget; the slice aliases device-mapped host memory and is
+	// only valid until the tracer unmaps it for the next block that
+	// reuses the same device buffer, so the renderer must consume it
+	// before requesting another block from the same tracer.
+	MappedData []float32
+
+	// DoneChan receives the block height once the block has been rendered.
+	DoneChan chan uint32
+
+	// ActiveChan optionally receives the number of pixels in the block
+	// that are still above TargetVariance once the block completes, so
+	// the renderer can stop scheduling further blocks for regions that
+	// have already converged. Left nil, the tracer skips reporting.
+	ActiveChan chan uint32
+
+	// ErrChan receives an error if the block could not be rendered.
+	ErrChan chan error
+}
+
+// Tracer is implemented by path tracer backends (e.g. opencl) that can
+// render blocks of a frame for a given scene.
+type Tracer interface {
+	// Id returns the tracer's unique id.
+	Id() string
+
+	// SpeedEstimate returns a relative performance estimate for the
+	// underlying device so the renderer can balance work across tracers.
+	SpeedEstimate() float32
+
+	// Close shuts down the tracer and releases its resources.
+	Close()
+
+	// Enqueue queues a block request for processing.
+	Enqueue(blockReq BlockRequest)
+}
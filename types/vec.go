@@ -0,0 +1,7 @@
+// Package types provides small math primitives shared across the scene and
+// tracer packages.
+package types
+
+// Vec4 is a 4-component vector, typically used to hold homogeneous
+// coordinates so it can be copied to opencl buffers without repacking.
+type Vec4 [4]float32